@@ -0,0 +1,171 @@
+package units
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/evergreen-ci/barque"
+	"github.com/mongodb/amboy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// QueueStatsExporter receives a queue's Stats on every tick of
+// amboyStatsCollector, so deployments can route them to whatever metrics
+// backend they use instead of only the grip.Info log line.
+type QueueStatsExporter interface {
+	Update(queueName string, stats amboy.QueueStats)
+}
+
+type noopStatsExporter struct{}
+
+func (noopStatsExporter) Update(string, amboy.QueueStats) {}
+
+var (
+	statsExporterMu sync.RWMutex
+	statsExporter   QueueStatsExporter = noopStatsExporter{}
+)
+
+// SetQueueStatsExporter installs the process-wide default exporter
+// amboyStatsCollector reports to when its barque.Environment doesn't
+// supply its own (see environmentQueueStatsExporter below). The exporter
+// can be Prometheus, OpenCensus, both, or a custom sink; a nil exporter
+// restores the no-op default. barque's service setup does not call this,
+// so the default stays the no-op exporter until a caller installs one.
+func SetQueueStatsExporter(e QueueStatsExporter) {
+	if e == nil {
+		e = noopStatsExporter{}
+	}
+
+	statsExporterMu.Lock()
+	defer statsExporterMu.Unlock()
+	statsExporter = e
+}
+
+func getQueueStatsExporter() QueueStatsExporter {
+	statsExporterMu.RLock()
+	defer statsExporterMu.RUnlock()
+	return statsExporter
+}
+
+// environmentQueueStatsExporter is satisfied by a barque.Environment that
+// owns its own QueueStatsExporter, so it can be scoped per-Environment
+// (e.g. per test, or per deployment config) instead of sharing the
+// process-global default installed by SetQueueStatsExporter.
+// barque.Environment's source isn't part of this package, so
+// amboyStatsCollector checks for this method via a type assertion rather
+// than requiring it in the interface directly; once barque.Environment
+// grows a QueueStatsExporter() method, it's picked up automatically.
+type environmentQueueStatsExporter interface {
+	QueueStatsExporter() QueueStatsExporter
+}
+
+// queueStatsExporterFor resolves the exporter amboyStatsCollector should
+// report to for env: env's own exporter if its concrete type implements
+// environmentQueueStatsExporter, otherwise the process-wide default.
+func queueStatsExporterFor(env barque.Environment) QueueStatsExporter {
+	if ewe, ok := env.(environmentQueueStatsExporter); ok {
+		if exporter := ewe.QueueStatsExporter(); exporter != nil {
+			return exporter
+		}
+	}
+
+	return getQueueStatsExporter()
+}
+
+var (
+	queueTotalGauge     = newQueueGauge("total", "total number of jobs in the queue")
+	queuePendingGauge   = newQueueGauge("pending", "number of jobs waiting to run")
+	queueRunningGauge   = newQueueGauge("running", "number of jobs currently running")
+	queueCompletedGauge = newQueueGauge("completed", "number of jobs that have completed")
+	queueBlockedGauge   = newQueueGauge("blocked", "number of jobs blocked on dependencies")
+)
+
+func newQueueGauge(name, help string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "amboy",
+		Subsystem: "queue",
+		Name:      name,
+		Help:      help,
+	}, []string{"queue"})
+	prometheus.MustRegister(gauge)
+	return gauge
+}
+
+// PrometheusStatsExporter updates the amboy_queue_* gauges registered
+// above, which PrometheusStatsHandler serves to a Prometheus scraper.
+type PrometheusStatsExporter struct{}
+
+func (PrometheusStatsExporter) Update(queueName string, s amboy.QueueStats) {
+	queueTotalGauge.WithLabelValues(queueName).Set(float64(s.Total))
+	queuePendingGauge.WithLabelValues(queueName).Set(float64(s.Pending))
+	queueRunningGauge.WithLabelValues(queueName).Set(float64(s.Running))
+	queueCompletedGauge.WithLabelValues(queueName).Set(float64(s.Completed))
+	queueBlockedGauge.WithLabelValues(queueName).Set(float64(s.Blocked))
+}
+
+// PrometheusStatsHandler returns a Prometheus scrape handler for the
+// default registry, which holds the amboy_queue_* gauges. The barque REST
+// service does not mount it at /metrics or anywhere else.
+func PrometheusStatsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+var (
+	queueNameKey = tag.MustNewKey("queue")
+
+	queueTotalMeasure     = stats.Int64("amboy/queue/total", "total number of jobs in the queue", stats.UnitDimensionless)
+	queuePendingMeasure   = stats.Int64("amboy/queue/pending", "number of jobs waiting to run", stats.UnitDimensionless)
+	queueRunningMeasure   = stats.Int64("amboy/queue/running", "number of jobs currently running", stats.UnitDimensionless)
+	queueCompletedMeasure = stats.Int64("amboy/queue/completed", "number of jobs that have completed", stats.UnitDimensionless)
+	queueBlockedMeasure   = stats.Int64("amboy/queue/blocked", "number of jobs blocked on dependencies", stats.UnitDimensionless)
+)
+
+// RegisterOpenCensusViews registers the last-value views for the queue
+// measures above. Call it once during startup, before installing an
+// OpenCensusStatsExporter, so that whatever view.Exporter the deployment
+// configured (stdout, an ocagent push exporter, etc.) receives data.
+func RegisterOpenCensusViews() error {
+	return view.Register(
+		&view.View{Name: "amboy/queue/total", Measure: queueTotalMeasure, Aggregation: view.LastValue(), TagKeys: []tag.Key{queueNameKey}},
+		&view.View{Name: "amboy/queue/pending", Measure: queuePendingMeasure, Aggregation: view.LastValue(), TagKeys: []tag.Key{queueNameKey}},
+		&view.View{Name: "amboy/queue/running", Measure: queueRunningMeasure, Aggregation: view.LastValue(), TagKeys: []tag.Key{queueNameKey}},
+		&view.View{Name: "amboy/queue/completed", Measure: queueCompletedMeasure, Aggregation: view.LastValue(), TagKeys: []tag.Key{queueNameKey}},
+		&view.View{Name: "amboy/queue/blocked", Measure: queueBlockedMeasure, Aggregation: view.LastValue(), TagKeys: []tag.Key{queueNameKey}},
+	)
+}
+
+// OpenCensusStatsExporter records the queue measures above, tagged with
+// the queue name, on every tick. Pair with RegisterOpenCensusViews and
+// whatever view.Exporter the deployment installed.
+type OpenCensusStatsExporter struct{}
+
+func (OpenCensusStatsExporter) Update(queueName string, s amboy.QueueStats) {
+	ctx, err := tag.New(context.Background(), tag.Insert(queueNameKey, queueName))
+	if err != nil {
+		return
+	}
+
+	stats.Record(ctx,
+		queueTotalMeasure.M(int64(s.Total)),
+		queuePendingMeasure.M(int64(s.Pending)),
+		queueRunningMeasure.M(int64(s.Running)),
+		queueCompletedMeasure.M(int64(s.Completed)),
+		queueBlockedMeasure.M(int64(s.Blocked)),
+	)
+}
+
+// MultiStatsExporter fans updates out to several exporters, so a
+// deployment can run Prometheus and OpenCensus side by side during a
+// migration.
+type MultiStatsExporter []QueueStatsExporter
+
+func (m MultiStatsExporter) Update(queueName string, s amboy.QueueStats) {
+	for _, exporter := range m {
+		exporter.Update(queueName, s)
+	}
+}
@@ -25,8 +25,12 @@ func init() {
 type amboyStatsCollector struct {
 	ExcludeLocal  bool `bson:"exclude_local" json:"exclude_local" yaml:"exclude_local"`
 	ExcludeRemote bool `bson:"exclude_remote" json:"exclude_remote" yaml:"exclude_remote"`
-	job.Base      `bson:"job_base" json:"job_base" yaml:"job_base"`
-	env           barque.Environment
+	// DisableLegacyLogging turns off the grip.Info line this job has
+	// always emitted, for deployments that have fully migrated to
+	// scraping/exporting the metrics registered in units/metrics.go.
+	DisableLegacyLogging bool `bson:"disable_legacy_logging" json:"disable_legacy_logging" yaml:"disable_legacy_logging"`
+	job.Base             `bson:"job_base" json:"job_base" yaml:"job_base"`
+	env                  barque.Environment
 }
 
 // NewLocalAmboyStatsCollector reports the status of only the local queue
@@ -74,18 +78,29 @@ func (j *amboyStatsCollector) Run(ctx context.Context) {
 	localQueue := j.env.LocalQueue()
 	remoteQueue := j.env.RemoteQueue()
 
+	exporter := queueStatsExporterFor(j.env)
+
 	if !j.ExcludeLocal && (localQueue != nil && localQueue.Info().Started) {
-		grip.Info(message.Fields{
-			"message": "amboy local queue stats",
-			"stats":   localQueue.Stats(ctx),
-		})
+		stats := localQueue.Stats(ctx)
+		exporter.Update("local", stats)
+
+		if !j.DisableLegacyLogging {
+			grip.Info(message.Fields{
+				"message": "amboy local queue stats",
+				"stats":   stats,
+			})
+		}
 	}
 
 	if !j.ExcludeRemote && (remoteQueue != nil && remoteQueue.Info().Started) {
-		grip.Info(message.Fields{
-			"message": "amboy remote queue stats",
-			"stats":   remoteQueue.Stats(ctx),
-		})
+		stats := remoteQueue.Stats(ctx)
+		exporter.Update("remote", stats)
 
+		if !j.DisableLegacyLogging {
+			grip.Info(message.Fields{
+				"message": "amboy remote queue stats",
+				"stats":   stats,
+			})
+		}
 	}
 }
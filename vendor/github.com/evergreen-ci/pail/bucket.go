@@ -0,0 +1,301 @@
+package pail
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Bucket defines an interface for interacting with a remote blob store,
+// e.g. S3 or GridFS.
+type Bucket interface {
+	Check(context.Context) error
+
+	Writer(context.Context, string) (io.WriteCloser, error)
+	Reader(context.Context, string) (io.ReadCloser, error)
+
+	Put(context.Context, string, io.Reader) error
+	Get(context.Context, string) (io.ReadCloser, error)
+	Upload(context.Context, string, string) error
+	Download(context.Context, string, string) error
+
+	Push(context.Context, SyncOptions) error
+	Pull(context.Context, SyncOptions) error
+	Copy(context.Context, CopyOptions) error
+
+	Remove(context.Context, string) error
+	RemoveMany(context.Context, ...string) error
+	RemovePrefix(context.Context, string) error
+	RemoveMatching(context.Context, string) error
+
+	List(context.Context, string) (BucketIterator, error)
+}
+
+// BucketIterator allows iteration over the contents of a bucket.
+type BucketIterator interface {
+	Next(context.Context) bool
+	Item() BucketItem
+	Err() error
+}
+
+// BucketItem describes a single object in a bucket.
+type BucketItem interface {
+	Name() string
+	Bucket() string
+	Hash() string
+	Get(context.Context) (io.ReadCloser, error)
+}
+
+type bucketItemImpl struct {
+	bucket string
+	key    string
+	b      Bucket
+}
+
+func (i *bucketItemImpl) Name() string   { return i.key }
+func (i *bucketItemImpl) Bucket() string { return i.bucket }
+func (i *bucketItemImpl) Hash() string   { return i.key }
+func (i *bucketItemImpl) Get(ctx context.Context) (io.ReadCloser, error) {
+	return i.b.Get(ctx, i.key)
+}
+
+// mockWriteCloser discards everything written to it; used for DryRun writes.
+type mockWriteCloser struct{}
+
+func (*mockWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (*mockWriteCloser) Close() error                { return nil }
+
+func consistentJoin(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(key, "/")
+}
+
+func newDigest(algo DigestAlgorithm) hash.Hash {
+	if algo == DigestSHA256 {
+		return sha256.New()
+	}
+	return md5.New()
+}
+
+func checksumFile(algo DigestAlgorithm, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem opening '%s'", path)
+	}
+	defer f.Close()
+
+	h := newDigest(algo)
+	if _, err = io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "problem hashing '%s'", path)
+	}
+
+	return fmtHash(h), nil
+}
+
+func fmtHash(h hash.Hash) string {
+	return strings.ToLower(hex.EncodeToString(h.Sum(nil)))
+}
+
+// verifyChecksum compares a digest that's been streamed through a file's
+// contents against that file's expected checksum, shared by
+// legacyGridFSFile and gridfsDownloadFile's Close methods. An empty
+// expected checksum means there's nothing to verify against (e.g. the
+// object predates checksum metadata), so it's not an error.
+func verifyChecksum(h hash.Hash, expected string) error {
+	if expected == "" {
+		return nil
+	}
+
+	if checksum := fmtHash(h); checksum != expected {
+		return errors.Errorf("checksum mismatch: expected %s, got %s", expected, checksum)
+	}
+
+	return nil
+}
+
+func walkLocalTree(_ context.Context, root string) ([]string, error) {
+	var out []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		out = append(out, rel)
+		return nil
+	})
+
+	return out, errors.WithStack(err)
+}
+
+func deleteOnPush(ctx context.Context, localPaths []string, remote string, b Bucket) error {
+	iter, err := b.List(ctx, remote)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	local := make(map[string]bool, len(localPaths))
+	for _, p := range localPaths {
+		local[consistentJoin(remote, p)] = true
+	}
+
+	for iter.Next(ctx) {
+		key := iter.Item().Name()
+		if !local[key] {
+			if err = b.Remove(ctx, key); err != nil {
+				return errors.Wrapf(err, "problem removing '%s'", key)
+			}
+		}
+	}
+
+	return errors.WithStack(iter.Err())
+}
+
+func deleteOnPull(_ context.Context, remoteKeys []string, local string) error {
+	remote := make(map[string]bool, len(remoteKeys))
+	for _, k := range remoteKeys {
+		remote[k] = true
+	}
+
+	return errors.WithStack(filepath.Walk(local, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(local, path)
+		if err != nil {
+			return err
+		}
+		if !remote[rel] {
+			return os.Remove(path)
+		}
+		return nil
+	}))
+}
+
+func removePrefix(ctx context.Context, prefix string, b Bucket) error {
+	iter, err := b.List(ctx, prefix)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for iter.Next(ctx) {
+		if err = b.Remove(ctx, iter.Item().Name()); err != nil {
+			return errors.Wrapf(err, "problem removing '%s'", iter.Item().Name())
+		}
+	}
+
+	return errors.WithStack(iter.Err())
+}
+
+// parallelDo dispatches fn over items on a worker pool bounded by
+// parallelism (at least 1), retrying each invocation with exponential
+// backoff up to maxRetries times on failure. It stops handing out new work
+// once ctx is canceled and collects every error with a grip.BasicCatcher.
+func parallelDo(ctx context.Context, parallelism, maxRetries int, items []string, fn func(context.Context, string) error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	work := make(chan string, len(items))
+	for _, item := range items {
+		work <- item
+	}
+	close(work)
+
+	catcher := grip.NewBasicCatcher()
+	catcherMu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				if ctx.Err() != nil {
+					catcherMu.Lock()
+					catcher.Add(errors.WithStack(ctx.Err()))
+					catcherMu.Unlock()
+					return
+				}
+
+				if err := retryWithBackoff(ctx, maxRetries, func() error { return fn(ctx, item) }); err != nil {
+					catcherMu.Lock()
+					catcher.Add(errors.Wrapf(err, "problem processing '%s'", item))
+					catcherMu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return catcher.Resolve()
+}
+
+func retryWithBackoff(ctx context.Context, maxRetries int, op func() error) error {
+	var err error
+	backoff := 100 * time.Millisecond
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if err = op(); err == nil {
+			return nil
+		}
+
+		if attempt == maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return err
+}
+
+func removeMatching(ctx context.Context, expression string, b Bucket) error {
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return errors.Wrap(err, "problem compiling regex")
+	}
+
+	iter, err := b.List(ctx, "")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for iter.Next(ctx) {
+		if re.MatchString(iter.Item().Name()) {
+			if err = b.Remove(ctx, iter.Item().Name()); err != nil {
+				return errors.Wrapf(err, "problem removing '%s'", iter.Item().Name())
+			}
+		}
+	}
+
+	return errors.WithStack(iter.Err())
+}
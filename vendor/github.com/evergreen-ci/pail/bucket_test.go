@@ -0,0 +1,60 @@
+package pail
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	require := require.New(t)
+
+	h := newDigest(DigestMD5)
+	_, err := h.Write([]byte("hello world"))
+	require.NoError(err)
+	sum := fmtHash(h)
+
+	t.Run("MatchingChecksumPasses", func(t *testing.T) {
+		h := newDigest(DigestMD5)
+		_, err := h.Write([]byte("hello world"))
+		require.NoError(err)
+		require.NoError(verifyChecksum(h, sum))
+	})
+
+	t.Run("MismatchedChecksumErrors", func(t *testing.T) {
+		h := newDigest(DigestMD5)
+		_, err := h.Write([]byte("goodbye world"))
+		require.NoError(err)
+		err = verifyChecksum(h, sum)
+		require.Error(err)
+		require.Contains(err.Error(), "checksum mismatch")
+	})
+
+	t.Run("EmptyExpectedIsNotAnError", func(t *testing.T) {
+		h := newDigest(DigestMD5)
+		_, err := h.Write([]byte("anything at all"))
+		require.NoError(err)
+		require.NoError(verifyChecksum(h, ""))
+	})
+}
+
+func TestParallelDoStopsOnCancellation(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = strconv.Itoa(i)
+	}
+
+	err := parallelDo(ctx, 4, 0, items, func(context.Context, string) error {
+		t.Fatal("fn should not run once ctx is already canceled")
+		return nil
+	})
+
+	require.Error(err)
+}
@@ -0,0 +1,595 @@
+package pail
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// gridfsBucket is a Bucket implementation backed by GridFS via the
+// context-aware go.mongodb.org/mongo-driver. Unlike gridfsLegacyBucket,
+// every operation threads the caller's ctx through the driver, so
+// cancellation actually aborts in-flight transfers.
+type gridfsBucket struct {
+	opts      GridFSOptions
+	client    *mongo.Client
+	bucket    *gridfs.Bucket
+	filesColl *mongo.Collection
+}
+
+// NewGridFSBucket creates a Bucket implementation backed by GridFS using
+// the mongo-driver, dialing a new client for the given URI.
+func NewGridFSBucket(ctx context.Context, opts GridFSOptions) (Bucket, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.MongoDBURI == "" {
+		return nil, errors.New("cannot create a new bucket without a URI")
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(opts.MongoDBURI))
+	if err != nil {
+		return nil, errors.Wrap(err, "problem connecting to MongoDB")
+	}
+
+	return NewGridFSBucketWithClient(ctx, client, opts)
+}
+
+// NewGridFSBucketWithClient is the same as NewGridFSBucket, but reuses an
+// existing client rather than dialing a new connection.
+func NewGridFSBucketWithClient(ctx context.Context, client *mongo.Client, opts GridFSOptions) (Bucket, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	db := client.Database(opts.Database)
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(opts.Name))
+	if err != nil {
+		return nil, errors.Wrap(err, "problem constructing GridFS bucket")
+	}
+
+	return &gridfsBucket{
+		opts:      opts,
+		client:    client,
+		bucket:    bucket,
+		filesColl: db.Collection(fmt.Sprintf("%s.files", opts.Name)),
+	}, nil
+}
+
+func (b *gridfsBucket) normalizeKey(key string) string {
+	if key == "" {
+		return b.opts.Prefix
+	}
+	return consistentJoin(b.opts.Prefix, key)
+}
+
+func (b *gridfsBucket) denormalizeKey(key string) string {
+	if b.opts.Prefix != "" && len(key) > len(b.opts.Prefix)+1 {
+		key = key[len(b.opts.Prefix)+1:]
+	}
+	return key
+}
+
+func (b *gridfsBucket) Check(ctx context.Context) error {
+	return errors.Wrap(b.client.Ping(ctx, nil), "problem contacting mongodb")
+}
+
+// gridfsFileMeta mirrors gridFSFileMeta from the legacy backend so that
+// Push/Pull detect changes identically across both implementations.
+type gridfsFileMeta struct {
+	Checksum  string `bson:"checksum"`
+	Algorithm string `bson:"algorithm"`
+}
+
+type gridfsUploadFile struct {
+	*gridfs.UploadStream
+	ctx       context.Context
+	filesColl *mongo.Collection
+	digest    hash.Hash
+	algo      DigestAlgorithm
+}
+
+func (f *gridfsUploadFile) Write(p []byte) (int, error) {
+	n, err := f.UploadStream.Write(p)
+	if f.digest != nil && n > 0 {
+		_, _ = f.digest.Write(p[:n])
+	}
+	return n, err
+}
+
+func (f *gridfsUploadFile) Close() error {
+	if err := f.UploadStream.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if f.digest == nil {
+		return nil
+	}
+
+	_, err := f.filesColl.UpdateOne(f.ctx,
+		bson.M{"_id": f.FileID},
+		bson.M{"$set": bson.M{"metadata": gridfsFileMeta{Checksum: fmtHash(f.digest), Algorithm: string(f.algo)}}},
+	)
+	return errors.Wrap(err, "problem recording checksum metadata")
+}
+
+type gridfsDownloadFile struct {
+	*gridfs.DownloadStream
+	ctx      context.Context
+	digest   hash.Hash
+	expected string
+}
+
+func (f *gridfsDownloadFile) Read(p []byte) (int, error) {
+	n, err := f.DownloadStream.Read(p)
+	if f.digest != nil && n > 0 {
+		_, _ = f.digest.Write(p[:n])
+	}
+	return n, err
+}
+
+func (f *gridfsDownloadFile) Close() error {
+	defer f.DownloadStream.Close()
+
+	if f.digest != nil {
+		return verifyChecksum(f.digest, f.expected)
+	}
+
+	return nil
+}
+
+func (b *gridfsBucket) Writer(ctx context.Context, name string) (io.WriteCloser, error) {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"dry_run":       b.opts.DryRun,
+		"operation":     "writer",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"key":           name,
+	})
+
+	if b.opts.DryRun {
+		return &mockWriteCloser{}, nil
+	}
+
+	stream, err := b.bucket.OpenUploadStream(ctx, b.normalizeKey(name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening upload stream for '%s'", name)
+	}
+
+	return &gridfsUploadFile{
+		UploadStream: stream,
+		ctx:          ctx,
+		filesColl:    b.filesColl,
+		digest:       newDigest(b.opts.Digest),
+		algo:         b.opts.Digest,
+	}, nil
+}
+
+func (b *gridfsBucket) Reader(ctx context.Context, name string) (io.ReadCloser, error) {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"operation":     "reader",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"key":           name,
+	})
+
+	stream, err := b.bucket.OpenDownloadStreamByName(ctx, b.normalizeKey(name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening download stream for '%s'", name)
+	}
+
+	out := &gridfsDownloadFile{DownloadStream: stream, ctx: ctx}
+	if b.opts.VerifyDigest {
+		out.digest = newDigest(b.opts.Digest)
+		out.expected = b.fileChecksum(ctx, b.normalizeKey(name))
+	}
+
+	return out, nil
+}
+
+func (b *gridfsBucket) fileChecksum(ctx context.Context, normalizedName string) string {
+	res := b.filesColl.FindOne(ctx, bson.M{"filename": normalizedName})
+
+	var doc struct {
+		Metadata gridfsFileMeta `bson:"metadata"`
+	}
+	if err := res.Decode(&doc); err != nil {
+		return ""
+	}
+
+	return doc.Metadata.Checksum
+}
+
+func (b *gridfsBucket) Put(ctx context.Context, name string, input io.Reader) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"dry_run":       b.opts.DryRun,
+		"operation":     "put",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"key":           name,
+	})
+
+	file, err := b.Writer(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "problem creating file")
+	}
+
+	if _, err = io.Copy(file, input); err != nil {
+		return errors.Wrap(err, "problem copying data")
+	}
+
+	return errors.Wrap(file.Close(), "problem flushing data to file")
+}
+
+func (b *gridfsBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"operation":     "get",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"key":           name,
+	})
+
+	return b.Reader(ctx, name)
+}
+
+func (b *gridfsBucket) Upload(ctx context.Context, name, path string) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"dry_run":       b.opts.DryRun,
+		"operation":     "upload",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"key":           name,
+		"path":          path,
+	})
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening file %s", name)
+	}
+	defer f.Close()
+
+	return errors.WithStack(b.Put(ctx, name, f))
+}
+
+func (b *gridfsBucket) Download(ctx context.Context, name, path string) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"operation":     "download",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"key":           name,
+		"path":          path,
+	})
+
+	reader, err := b.Reader(ctx, name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "problem creating enclosing directory for '%s'", path)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating file '%s'", path)
+	}
+
+	if _, err = io.Copy(f, reader); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "problem copying data")
+	}
+
+	if err = reader.Close(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "problem verifying downloaded data")
+	}
+
+	return errors.WithStack(f.Close())
+}
+
+func (b *gridfsBucket) Push(ctx context.Context, opts SyncOptions) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"dry_run":       b.opts.DryRun,
+		"operation":     "push",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"remote":        opts.Remote,
+		"local":         opts.Local,
+		"exclude":       opts.Exclude,
+	})
+
+	var re *regexp.Regexp
+	var err error
+	if opts.Exclude != "" {
+		re, err = regexp.Compile(opts.Exclude)
+		if err != nil {
+			return errors.Wrap(err, "problem compiling exclude regex")
+		}
+	}
+
+	localPaths, err := walkLocalTree(ctx, opts.Local)
+	if err != nil {
+		return errors.Wrap(err, "problem finding local paths")
+	}
+
+	paths := make([]string, 0, len(localPaths))
+	for _, path := range localPaths {
+		if re != nil && re.MatchString(path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	err = parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, paths, func(ctx context.Context, path string) error {
+		target := consistentJoin(opts.Remote, path)
+		checksum := b.fileChecksum(ctx, b.normalizeKey(target))
+		if checksum == "" {
+			return errors.WithStack(b.Upload(ctx, target, filepath.Join(opts.Local, path)))
+		}
+
+		localChecksum, err := checksumFile(b.opts.Digest, filepath.Join(opts.Local, path))
+		if err != nil {
+			return errors.Wrapf(err, "problem checksumming '%s'", path)
+		}
+
+		if checksum != localChecksum {
+			return errors.WithStack(b.Upload(ctx, target, filepath.Join(opts.Local, path)))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if (b.opts.DeleteOnPush || b.opts.DeleteOnSync) && !b.opts.DryRun {
+		return errors.Wrap(deleteOnPush(ctx, localPaths, opts.Remote, b), "problem with delete on sync after push")
+	}
+	return nil
+}
+
+func (b *gridfsBucket) Pull(ctx context.Context, opts SyncOptions) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"operation":     "pull",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"remote":        opts.Remote,
+		"local":         opts.Local,
+		"exclude":       opts.Exclude,
+	})
+
+	var re *regexp.Regexp
+	var err error
+	if opts.Exclude != "" {
+		re, err = regexp.Compile(opts.Exclude)
+		if err != nil {
+			return errors.Wrap(err, "problem compiling exclude regex")
+		}
+	}
+
+	iter, err := b.List(ctx, opts.Remote)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	remoteNames := []string{}
+	for iter.Next(ctx) {
+		item := iter.Item()
+		if re != nil && re.MatchString(item.Name()) {
+			continue
+		}
+		remoteNames = append(remoteNames, item.Name())
+	}
+
+	if err = iter.Err(); err != nil {
+		return errors.Wrap(err, "problem iterating bucket")
+	}
+
+	keys := make([]string, 0, len(remoteNames))
+	for _, remoteName := range remoteNames {
+		keys = append(keys, strings.TrimPrefix(strings.TrimPrefix(remoteName, opts.Remote), "/"))
+	}
+
+	err = parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, remoteNames, func(ctx context.Context, remoteName string) error {
+		relPath := strings.TrimPrefix(strings.TrimPrefix(remoteName, opts.Remote), "/")
+		name := filepath.Join(opts.Local, relPath)
+
+		localChecksum, err := checksumFile(b.opts.Digest, name)
+		if os.IsNotExist(errors.Cause(err)) {
+			return errors.WithStack(b.Download(ctx, remoteName, name))
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if b.fileChecksum(ctx, b.normalizeKey(remoteName)) != localChecksum {
+			return errors.WithStack(b.Download(ctx, remoteName, name))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if (b.opts.DeleteOnPull || b.opts.DeleteOnSync) && !b.opts.DryRun {
+		return errors.Wrap(deleteOnPull(ctx, keys, opts.Local), "problem with delete on sync after pull")
+	}
+	return nil
+}
+
+func (b *gridfsBucket) Copy(ctx context.Context, options CopyOptions) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"operation":     "copy",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"source_key":    options.SourceKey,
+		"dest_key":      options.DestinationKey,
+	})
+
+	from, err := b.Reader(ctx, options.SourceKey)
+	if err != nil {
+		return errors.Wrap(err, "problem getting reader for source")
+	}
+
+	to, err := options.DestinationBucket.Writer(ctx, options.DestinationKey)
+	if err != nil {
+		return errors.Wrap(err, "problem getting writer for destination")
+	}
+
+	if _, err = io.Copy(to, from); err != nil {
+		return errors.Wrap(err, "problem copying data")
+	}
+
+	return errors.WithStack(to.Close())
+}
+
+func (b *gridfsBucket) Remove(ctx context.Context, key string) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"dry_run":       b.opts.DryRun,
+		"operation":     "remove",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"key":           key,
+	})
+
+	if b.opts.DryRun {
+		return nil
+	}
+
+	res := b.filesColl.FindOne(ctx, bson.M{"filename": b.normalizeKey(key)})
+	var doc struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := res.Decode(&doc); err != nil {
+		return errors.Wrapf(err, "problem finding file %s", key)
+	}
+
+	return errors.Wrapf(b.bucket.Delete(ctx, doc.ID), "problem removing file %s", key)
+}
+
+func (b *gridfsBucket) RemoveMany(ctx context.Context, keys ...string) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"dry_run":       b.opts.DryRun,
+		"operation":     "remove many",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"keys":          keys,
+	})
+
+	return parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, keys, func(ctx context.Context, key string) error {
+		return b.Remove(ctx, key)
+	})
+}
+
+func (b *gridfsBucket) RemovePrefix(ctx context.Context, prefix string) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"dry_run":       b.opts.DryRun,
+		"operation":     "remove prefix",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"prefix":        prefix,
+	})
+
+	return removePrefix(ctx, prefix, b)
+}
+
+func (b *gridfsBucket) RemoveMatching(ctx context.Context, expression string) error {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"dry_run":       b.opts.DryRun,
+		"operation":     "remove matching",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"expression":    expression,
+	})
+
+	return removeMatching(ctx, expression, b)
+}
+
+func (b *gridfsBucket) List(ctx context.Context, prefix string) (BucketIterator, error) {
+	grip.DebugWhen(b.opts.Verbose, message.Fields{
+		"type":          "gridfs",
+		"operation":     "list",
+		"bucket":        b.opts.Name,
+		"bucket_prefix": b.opts.Prefix,
+		"prefix":        prefix,
+	})
+
+	if ctx.Err() != nil {
+		return nil, errors.New("operation canceled")
+	}
+
+	filter := bson.M{}
+	if prefix != "" {
+		filter = bson.M{"filename": primitive.Regex{Pattern: fmt.Sprintf("^%s.*", regexp.QuoteMeta(b.normalizeKey(prefix)))}}
+	}
+
+	cursor, err := b.bucket.Find(ctx, filter, options.GridFSFind().SetBatchSize(100).SetMaxTime(30*time.Second))
+	if err != nil {
+		return nil, errors.Wrap(err, "problem listing bucket")
+	}
+
+	return &gridfsIterator{ctx: ctx, cursor: cursor, bucket: b}, nil
+}
+
+type gridfsIterator struct {
+	ctx    context.Context
+	err    error
+	item   *bucketItemImpl
+	bucket *gridfsBucket
+	cursor *mongo.Cursor
+}
+
+func (iter *gridfsIterator) Err() error       { return iter.err }
+func (iter *gridfsIterator) Item() BucketItem { return iter.item }
+
+func (iter *gridfsIterator) Next(ctx context.Context) bool {
+	if !iter.cursor.Next(ctx) {
+		iter.err = errors.WithStack(iter.cursor.Err())
+		return false
+	}
+
+	var doc struct {
+		Filename string `bson:"filename"`
+	}
+	if err := iter.cursor.Decode(&doc); err != nil {
+		iter.err = errors.Wrap(err, "problem decoding GridFS file document")
+		return false
+	}
+
+	iter.item = &bucketItemImpl{
+		bucket: iter.bucket.opts.Prefix,
+		key:    iter.bucket.denormalizeKey(doc.Filename),
+		b:      iter.bucket,
+	}
+
+	return true
+}
@@ -1,12 +1,16 @@
+// +build legacy_mgo
+
 package pail
 
 import (
 	"context"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/mongodb/grip"
@@ -16,6 +20,24 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
+// gridFSFileMeta is stored in a GridFS file's metadata document so that
+// Push/Pull can detect changes even though the legacy mgo driver never
+// populates GridFile.MD5().
+type gridFSFileMeta struct {
+	Checksum  string `bson:"checksum"`
+	Algorithm string `bson:"algorithm"`
+}
+
+// metadataChecksum returns the checksum recorded in a file's metadata, or
+// the empty string if none was ever written.
+func metadataChecksum(f *mgo.GridFile) string {
+	meta := gridFSFileMeta{}
+	if err := f.GetMeta(&meta); err != nil {
+		return ""
+	}
+	return meta.Checksum
+}
+
 type gridfsLegacyBucket struct {
 	opts    GridFSOptions
 	session *mgo.Session
@@ -109,8 +131,15 @@ func (b *gridfsLegacyBucket) openFile(ctx context.Context, name string, create b
 
 	if create {
 		file, err = gridfs.Create(normalizedName)
+		out.algo = b.opts.Digest
+		out.digest = newDigest(out.algo)
 	} else {
 		file, err = gridfs.Open(normalizedName)
+		if err == nil && b.opts.VerifyDigest {
+			out.algo = b.opts.Digest
+			out.digest = newDigest(out.algo)
+			out.verify = true
+		}
 	}
 	if err != nil {
 		ses.Close()
@@ -129,9 +158,47 @@ func (b *gridfsLegacyBucket) openFile(ctx context.Context, name string, create b
 type legacyGridFSFile struct {
 	*mgo.GridFile
 	cancel context.CancelFunc
+
+	// digest is non-nil when this file's contents should be hashed as
+	// they stream through, either to populate the metadata checksum on
+	// write or to verify it on read.
+	digest hash.Hash
+	algo   DigestAlgorithm
+	verify bool
+}
+
+func (f *legacyGridFSFile) Write(p []byte) (int, error) {
+	n, err := f.GridFile.Write(p)
+	if f.digest != nil && n > 0 {
+		_, _ = f.digest.Write(p[:n])
+	}
+	return n, err
 }
 
-func (f *legacyGridFSFile) Close() error { f.cancel(); return errors.WithStack(f.GridFile.Close()) }
+func (f *legacyGridFSFile) Read(p []byte) (int, error) {
+	n, err := f.GridFile.Read(p)
+	if f.digest != nil && n > 0 {
+		_, _ = f.digest.Write(p[:n])
+	}
+	return n, err
+}
+
+func (f *legacyGridFSFile) Close() error {
+	defer f.cancel()
+
+	if f.digest != nil {
+		if f.verify {
+			if err := verifyChecksum(f.digest, metadataChecksum(f.GridFile)); err != nil {
+				_ = f.GridFile.Close()
+				return errors.Wrapf(err, "problem reading '%s'", f.GridFile.Name())
+			}
+		} else {
+			f.GridFile.SetMeta(gridFSFileMeta{Checksum: fmtHash(f.digest), Algorithm: string(f.algo)})
+		}
+	}
+
+	return errors.WithStack(f.GridFile.Close())
+}
 
 func (b *gridfsLegacyBucket) Writer(ctx context.Context, name string) (io.WriteCloser, error) {
 	grip.DebugWhen(b.opts.Verbose, message.Fields{
@@ -280,33 +347,41 @@ func (b *gridfsLegacyBucket) Push(ctx context.Context, opts SyncOptions) error {
 		return errors.Wrap(err, "problem finding local paths")
 	}
 
-	gridfs := b.gridFS()
+	paths := make([]string, 0, len(localPaths))
 	for _, path := range localPaths {
 		if re != nil && re.MatchString(path) {
 			continue
 		}
+		paths = append(paths, path)
+	}
 
+	err = parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, paths, func(ctx context.Context, path string) error {
 		target := consistentJoin(opts.Remote, path)
-		file, err := gridfs.Open(b.normalizeKey(target))
+		file, err := b.gridFS().Open(b.normalizeKey(target))
 		if err == mgo.ErrNotFound {
-			if err = b.Upload(ctx, target, filepath.Join(opts.Local, path)); err != nil {
-				return errors.Wrapf(err, "problem uploading '%s' to '%s'", path, target)
-			}
-			continue
+			return errors.WithStack(b.Upload(ctx, target, filepath.Join(opts.Local, path)))
 		} else if err != nil {
 			return errors.Wrapf(err, "problem finding '%s'", target)
 		}
 
-		localmd5, err := md5sum(filepath.Join(opts.Local, path))
+		localChecksum, err := checksumFile(b.opts.Digest, filepath.Join(opts.Local, path))
 		if err != nil {
 			return errors.Wrapf(err, "problem checksumming '%s'", path)
 		}
 
-		if file.MD5() != localmd5 {
-			if err = b.Upload(ctx, target, filepath.Join(opts.Local, path)); err != nil {
-				return errors.Wrapf(err, "problem uploading '%s' to '%s'", path, target)
-			}
+		remoteChecksum := file.MD5()
+		if remoteChecksum == "" {
+			remoteChecksum = metadataChecksum(file)
 		}
+
+		if remoteChecksum != localChecksum {
+			return errors.WithStack(b.Upload(ctx, target, filepath.Join(opts.Local, path)))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	if (b.opts.DeleteOnPush || b.opts.DeleteOnSync) && !b.opts.DryRun {
@@ -345,9 +420,13 @@ func (b *gridfsLegacyBucket) Pull(ctx context.Context, opts SyncOptions) error {
 		return errors.New("programmer error")
 	}
 
+	// OpenNext drives a server-side cursor and must be exhausted serially;
+	// collect the remote checksums here and fan out the local compare
+	// and download work below.
 	gridfs := b.gridFS()
 	var f *mgo.GridFile
-	var checksum string
+	denormalizedNames := []string{}
+	remoteChecksums := map[string]string{}
 	keys := []string{}
 	for gridfs.OpenNext(iterimpl.iter, &f) {
 		if re != nil && re.MatchString(f.Name()) {
@@ -355,30 +434,42 @@ func (b *gridfsLegacyBucket) Pull(ctx context.Context, opts SyncOptions) error {
 		}
 
 		denormalizedName := b.denormalizeKey(f.Name())
-		fn := denormalizedName[len(opts.Remote)+1:]
-		name := filepath.Join(opts.Local, fn)
+		fn := strings.TrimPrefix(strings.TrimPrefix(denormalizedName, opts.Remote), "/")
 		keys = append(keys, fn)
-		checksum, err = md5sum(name)
+		denormalizedNames = append(denormalizedNames, denormalizedName)
+
+		// The legacy mgo driver never populates GridFile.MD5(), so
+		// fall back to the checksum we wrote into the file's
+		// metadata on upload.
+		remoteChecksum := f.MD5()
+		if remoteChecksum == "" {
+			remoteChecksum = metadataChecksum(f)
+		}
+		remoteChecksums[denormalizedName] = remoteChecksum
+	}
+
+	if err = iterimpl.iter.Err(); err != nil {
+		return errors.Wrap(err, "problem iterating bucket")
+	}
+
+	err = parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, denormalizedNames, func(ctx context.Context, denormalizedName string) error {
+		name := filepath.Join(opts.Local, strings.TrimPrefix(strings.TrimPrefix(denormalizedName, opts.Remote), "/"))
+
+		localChecksum, err := checksumFile(b.opts.Digest, name)
 		if os.IsNotExist(errors.Cause(err)) {
-			if err = b.Download(ctx, denormalizedName, name); err != nil {
-				return errors.WithStack(err)
-			}
-			continue
+			return errors.WithStack(b.Download(ctx, denormalizedName, name))
 		} else if err != nil {
 			return errors.WithStack(err)
 		}
 
-		// NOTE: it doesn't seem like the md5 sums are being
-		// populated, so this always happens
-		if f.MD5() != checksum {
-			if err = b.Download(ctx, denormalizedName, name); err != nil {
-				return errors.WithStack(err)
-			}
+		if remoteChecksums[denormalizedName] != localChecksum {
+			return errors.WithStack(b.Download(ctx, denormalizedName, name))
 		}
-	}
 
-	if err = iterimpl.iter.Err(); err != nil {
-		return errors.Wrap(err, "problem iterating bucket")
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	if (b.opts.DeleteOnPull || b.opts.DeleteOnSync) && !b.opts.DryRun {
@@ -440,11 +531,9 @@ func (b *gridfsLegacyBucket) RemoveMany(ctx context.Context, keys ...string) err
 		"keys":          keys,
 	})
 
-	catcher := grip.NewBasicCatcher()
-	for _, key := range keys {
-		catcher.Add(b.Remove(ctx, key))
-	}
-	return catcher.Resolve()
+	return parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, keys, func(ctx context.Context, key string) error {
+		return b.Remove(ctx, key)
+	})
 }
 
 func (b *gridfsLegacyBucket) RemovePrefix(ctx context.Context, prefix string) error {
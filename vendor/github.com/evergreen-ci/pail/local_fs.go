@@ -0,0 +1,367 @@
+package pail
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/evergreen-ci/pail/vfs"
+	"github.com/pkg/errors"
+)
+
+// filesystemBucket is a Bucket backed by a vfs.Filesystem rather than a
+// remote store. Any vfs.Filesystem works, including a real go-billy
+// filesystem rooted on disk (wrapped with vfs.FromBilly) or vfs.NewMemFS
+// for tests; Push and Pull still
+// compare against the real OS disk, the same way gridfsBucket and
+// gridfsLegacyBucket treat SyncOptions.Local.
+type filesystemBucket struct {
+	opts LocalOptions
+	fs   vfs.Filesystem
+}
+
+// NewFilesystemBucket returns a Bucket that stores objects under opts.Path
+// in fs. Pass a real go-billy filesystem wrapped with vfs.FromBilly to
+// back it with disk, or vfs.NewMemFS() for an in-memory bucket in unit
+// tests.
+func NewFilesystemBucket(fs vfs.Filesystem, opts LocalOptions) (Bucket, error) {
+	if err := opts.validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &filesystemBucket{opts: opts, fs: fs}, nil
+}
+
+func (b *filesystemBucket) normalizeKey(key string) string {
+	return consistentJoin(b.opts.Prefix, key)
+}
+
+func (b *filesystemBucket) denormalizeKey(key string) string {
+	if b.opts.Prefix != "" && len(key) > len(b.opts.Prefix)+1 {
+		key = key[len(b.opts.Prefix)+1:]
+	}
+	return key
+}
+
+func (b *filesystemBucket) path(key string) string {
+	return b.fs.Join(b.opts.Path, b.normalizeKey(key))
+}
+
+func (b *filesystemBucket) Check(ctx context.Context) error {
+	_, err := b.fs.Stat(b.opts.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (b *filesystemBucket) Writer(ctx context.Context, key string) (io.WriteCloser, error) {
+	if b.opts.DryRun {
+		return &mockWriteCloser{}, nil
+	}
+
+	normalized := b.normalizeKey(key)
+	if dir := path.Dir(normalized); dir != "." && dir != "/" {
+		if err := b.fs.MkdirAll(b.fs.Join(b.opts.Path, dir), 0755); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	f, err := b.fs.Create(b.path(key))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem creating '%s'", key)
+	}
+
+	return f, nil
+}
+
+func (b *filesystemBucket) Reader(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := b.fs.Open(b.path(key))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening '%s'", key)
+	}
+
+	return f, nil
+}
+
+func (b *filesystemBucket) Put(ctx context.Context, key string, r io.Reader) error {
+	w, err := b.Writer(ctx, key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err = io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return errors.Wrapf(err, "problem writing '%s'", key)
+	}
+
+	return errors.WithStack(w.Close())
+}
+
+func (b *filesystemBucket) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return b.Reader(ctx, key)
+}
+
+func (b *filesystemBucket) Upload(ctx context.Context, key, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening '%s'", localPath)
+	}
+	defer f.Close()
+
+	return errors.WithStack(b.Put(ctx, key, f))
+}
+
+func (b *filesystemBucket) Download(ctx context.Context, key, localPath string) error {
+	r, err := b.Reader(ctx, key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer r.Close()
+
+	f, err := os.Create(localPath)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating '%s'", localPath)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return errors.Wrapf(err, "problem downloading '%s'", key)
+}
+
+// fileChecksum hashes the object currently stored at key. Unlike GridFS,
+// the vfs.Filesystem has nowhere to cache a checksum in metadata, so Push
+// and Pull must recompute it from content on every comparison.
+func (b *filesystemBucket) fileChecksum(key string) (string, error) {
+	f, err := b.fs.Open(b.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	h := newDigest(b.opts.Digest)
+	if _, err = io.Copy(h, f); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return fmtHash(h), nil
+}
+
+func (b *filesystemBucket) Push(ctx context.Context, opts SyncOptions) error {
+	paths, err := walkLocalTree(ctx, opts.Local)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if opts.Exclude != "" {
+		re, rerr := regexp.Compile(opts.Exclude)
+		if rerr != nil {
+			return errors.Wrap(rerr, "problem compiling regex")
+		}
+		filtered := paths[:0]
+		for _, p := range paths {
+			if !re.MatchString(p) {
+				filtered = append(filtered, p)
+			}
+		}
+		paths = filtered
+	}
+
+	err = parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, paths, func(ctx context.Context, relPath string) error {
+		localSum, serr := checksumFile(b.opts.Digest, filepath.Join(opts.Local, relPath))
+		if serr != nil {
+			return errors.WithStack(serr)
+		}
+
+		key := consistentJoin(opts.Remote, relPath)
+		remoteSum, serr := b.fileChecksum(key)
+		if serr != nil {
+			return errors.WithStack(serr)
+		}
+
+		if remoteSum == localSum {
+			return nil
+		}
+
+		return errors.WithStack(b.Upload(ctx, key, filepath.Join(opts.Local, relPath)))
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if b.opts.DeleteOnSync || b.opts.DeleteOnPush {
+		return errors.WithStack(deleteOnPush(ctx, paths, opts.Remote, b))
+	}
+
+	return nil
+}
+
+func (b *filesystemBucket) Pull(ctx context.Context, opts SyncOptions) error {
+	iter, err := b.List(ctx, opts.Remote)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Item().Name())
+	}
+	if err = iter.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if opts.Exclude != "" {
+		re, rerr := regexp.Compile(opts.Exclude)
+		if rerr != nil {
+			return errors.Wrap(rerr, "problem compiling regex")
+		}
+		filtered := keys[:0]
+		for _, k := range keys {
+			if !re.MatchString(k) {
+				filtered = append(filtered, k)
+			}
+		}
+		keys = filtered
+	}
+
+	err = parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, keys, func(ctx context.Context, key string) error {
+		relPath := strings.TrimPrefix(strings.TrimPrefix(key, opts.Remote), "/")
+		localPath := filepath.Join(opts.Local, relPath)
+
+		remoteSum, serr := b.fileChecksum(key)
+		if serr != nil {
+			return errors.WithStack(serr)
+		}
+
+		localSum, serr := checksumFile(b.opts.Digest, localPath)
+		if serr == nil && localSum == remoteSum {
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return errors.WithStack(b.Download(ctx, key, localPath))
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if b.opts.DeleteOnSync || b.opts.DeleteOnPull {
+		return errors.WithStack(deleteOnPull(ctx, keys, opts.Local))
+	}
+
+	return nil
+}
+
+func (b *filesystemBucket) Copy(ctx context.Context, opts CopyOptions) error {
+	r, err := b.Reader(ctx, opts.SourceKey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer r.Close()
+
+	dest := opts.DestinationBucket
+	if dest == nil {
+		dest = b
+	}
+
+	w, err := dest.Writer(ctx, opts.DestinationKey)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err = io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return errors.Wrapf(err, "problem copying '%s' to '%s'", opts.SourceKey, opts.DestinationKey)
+	}
+
+	return errors.WithStack(w.Close())
+}
+
+func (b *filesystemBucket) Remove(ctx context.Context, key string) error {
+	if b.opts.DryRun {
+		return nil
+	}
+
+	if err := b.fs.Remove(b.path(key)); err != nil {
+		return errors.Wrapf(err, "problem removing '%s'", key)
+	}
+
+	return nil
+}
+
+func (b *filesystemBucket) RemoveMany(ctx context.Context, keys ...string) error {
+	return errors.WithStack(parallelDo(ctx, b.opts.Parallelism, b.opts.MaxRetries, keys, func(ctx context.Context, key string) error {
+		return b.Remove(ctx, key)
+	}))
+}
+
+func (b *filesystemBucket) RemovePrefix(ctx context.Context, prefix string) error {
+	return errors.WithStack(removePrefix(ctx, prefix, b))
+}
+
+func (b *filesystemBucket) RemoveMatching(ctx context.Context, expression string) error {
+	return errors.WithStack(removeMatching(ctx, expression, b))
+}
+
+func (b *filesystemBucket) List(ctx context.Context, prefix string) (BucketIterator, error) {
+	root := b.normalizeKey(prefix)
+	names, err := walkVFSTree(b.fs, b.fs.Join(b.opts.Path, root), root)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &filesystemIterator{bucket: b, names: names, idx: -1}, nil
+}
+
+func walkVFSTree(fs vfs.Filesystem, fsDir, keyPrefix string) ([]string, error) {
+	entries, err := fs.ReadDir(fsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	var out []string
+	for _, entry := range entries {
+		key := consistentJoin(keyPrefix, entry.Name())
+		if entry.IsDir() {
+			children, cerr := walkVFSTree(fs, fs.Join(fsDir, entry.Name()), key)
+			if cerr != nil {
+				return nil, cerr
+			}
+			out = append(out, children...)
+			continue
+		}
+		out = append(out, key)
+	}
+
+	return out, nil
+}
+
+type filesystemIterator struct {
+	bucket *filesystemBucket
+	names  []string
+	idx    int
+}
+
+func (it *filesystemIterator) Next(ctx context.Context) bool {
+	it.idx++
+	return it.idx < len(it.names)
+}
+
+func (it *filesystemIterator) Item() BucketItem {
+	return &bucketItemImpl{bucket: it.bucket.opts.Path, key: it.bucket.denormalizeKey(it.names[it.idx]), b: it.bucket}
+}
+
+func (it *filesystemIterator) Err() error { return nil }
@@ -0,0 +1,95 @@
+package pail
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/evergreen-ci/pail/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemBucketPushPullRoundTripWithPrefix(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	localDir, err := ioutil.TempDir("", "pail-local-fs-push")
+	require.NoError(err)
+	defer os.RemoveAll(localDir)
+
+	content := []byte("hello from the filesystem bucket test")
+	require.NoError(ioutil.WriteFile(filepath.Join(localDir, "greeting.txt"), content, 0644))
+
+	b, err := NewFilesystemBucket(vfs.NewMemFS(), LocalOptions{
+		Path:   "bucket-root",
+		Prefix: "a-prefix",
+	})
+	require.NoError(err)
+
+	require.NoError(b.Push(ctx, SyncOptions{Local: localDir, Remote: "objects"}))
+
+	iter, err := b.List(ctx, "objects")
+	require.NoError(err)
+
+	var names []string
+	for iter.Next(ctx) {
+		names = append(names, iter.Item().Name())
+	}
+	require.NoError(iter.Err())
+	require.Equal([]string{"objects/greeting.txt"}, names)
+
+	pullDir, err := ioutil.TempDir("", "pail-local-fs-pull")
+	require.NoError(err)
+	defer os.RemoveAll(pullDir)
+
+	require.NoError(b.Pull(ctx, SyncOptions{Local: pullDir, Remote: "objects"}))
+
+	pulled, err := ioutil.ReadFile(filepath.Join(pullDir, "greeting.txt"))
+	require.NoError(err)
+	require.Equal(content, pulled)
+}
+
+func TestFilesystemBucketListDoesNotLeakSiblingKeys(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	b, err := NewFilesystemBucket(vfs.NewMemFS(), LocalOptions{Path: "bucket-root"})
+	require.NoError(err)
+
+	require.NoError(b.Put(ctx, "v4.4/a.tgz", strings.NewReader("a")))
+	require.NoError(b.Put(ctx, "v4.4.1.tgz", strings.NewReader("b")))
+
+	iter, err := b.List(ctx, "v4.4")
+	require.NoError(err)
+
+	var names []string
+	for iter.Next(ctx) {
+		names = append(names, iter.Item().Name())
+	}
+	require.NoError(iter.Err())
+	require.Equal([]string{"v4.4/a.tgz"}, names)
+}
+
+func TestFilesystemBucketRemovePrefixWithPrefix(t *testing.T) {
+	ctx := context.Background()
+	require := require.New(t)
+
+	b, err := NewFilesystemBucket(vfs.NewMemFS(), LocalOptions{
+		Path:   "bucket-root",
+		Prefix: "a-prefix",
+	})
+	require.NoError(err)
+
+	require.NoError(b.Put(ctx, "objects/one.txt", strings.NewReader("one")))
+	require.NoError(b.Put(ctx, "objects/two.txt", strings.NewReader("two")))
+
+	require.NoError(b.RemovePrefix(ctx, "objects"))
+
+	iter, err := b.List(ctx, "objects")
+	require.NoError(err)
+	require.False(iter.Next(ctx))
+	require.NoError(iter.Err())
+}
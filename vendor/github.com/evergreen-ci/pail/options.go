@@ -0,0 +1,121 @@
+package pail
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DigestAlgorithm describes the hash function used to checksum objects as
+// they stream through Put/Upload, for backends (like the legacy GridFS
+// driver) that don't populate their own checksums.
+type DigestAlgorithm string
+
+const (
+	DigestMD5    DigestAlgorithm = "md5"
+	DigestSHA256 DigestAlgorithm = "sha256"
+)
+
+// GridFSOptions support the use and creation of GridFS backed buckets.
+type GridFSOptions struct {
+	Database string
+	Name     string
+	Prefix   string
+	DryRun   bool
+	Verbose  bool
+
+	MongoDBURI string
+
+	DeleteOnSync bool
+	DeleteOnPush bool
+	DeleteOnPull bool
+
+	// Digest selects the hash function used to populate a file's
+	// metadata checksum when the underlying driver doesn't compute one
+	// itself (the legacy mgo driver never populates GridFile.MD5()).
+	// Defaults to DigestMD5.
+	Digest DigestAlgorithm
+
+	// VerifyDigest causes Reader/Download to recompute and check the
+	// digest against the stored metadata checksum, returning an error
+	// on mismatch.
+	VerifyDigest bool
+
+	// Parallelism bounds the number of concurrent file transfers that
+	// Push, Pull, and RemoveMany will perform. Defaults to 1 (serial)
+	// when unset.
+	Parallelism int
+
+	// MaxRetries bounds the number of times a single file transfer is
+	// retried, with exponential backoff, after a transient error.
+	MaxRetries int
+}
+
+func (o *GridFSOptions) validate() error {
+	if o.Name == "" {
+		return errors.New("must specify a name for the bucket")
+	}
+
+	if o.Digest == "" {
+		o.Digest = DigestMD5
+	}
+
+	switch o.Digest {
+	case DigestMD5, DigestSHA256:
+	default:
+		return errors.Errorf("invalid digest algorithm '%s'", o.Digest)
+	}
+
+	return nil
+}
+
+// SyncOptions describes the behavior of Push and Pull.
+type SyncOptions struct {
+	Local   string
+	Remote  string
+	Exclude string
+}
+
+// LocalOptions support the use and creation of filesystem backed buckets,
+// whether that filesystem is real disk or an abstract vfs.Filesystem
+// (e.g. an in-memory fixture).
+type LocalOptions struct {
+	Path    string
+	Prefix  string
+	DryRun  bool
+	Verbose bool
+
+	DeleteOnSync bool
+	DeleteOnPush bool
+	DeleteOnPull bool
+
+	// Digest selects the hash function used to detect changed files
+	// during Push/Pull. Defaults to DigestMD5.
+	Digest DigestAlgorithm
+
+	Parallelism int
+	MaxRetries  int
+}
+
+func (o *LocalOptions) validate() error {
+	if o.Path == "" {
+		return errors.New("must specify a root path for the bucket")
+	}
+
+	if o.Digest == "" {
+		o.Digest = DigestMD5
+	}
+
+	switch o.Digest {
+	case DigestMD5, DigestSHA256:
+	default:
+		return errors.Errorf("invalid digest algorithm '%s'", o.Digest)
+	}
+
+	return nil
+}
+
+// CopyOptions describes the behavior of Copy.
+type CopyOptions struct {
+	SourceKey         string
+	DestinationKey    string
+	DestinationBucket Bucket
+}
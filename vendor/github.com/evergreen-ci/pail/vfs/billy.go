@@ -0,0 +1,38 @@
+package vfs
+
+import (
+	"os"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+)
+
+// billyFS adapts a billy.Filesystem to Filesystem. Every method but
+// Open/Create forwards unchanged; those two return billy.File, a named
+// interface distinct from File, so they need retyping even though
+// billy.File's method set already satisfies File.
+type billyFS struct {
+	fs billy.Filesystem
+}
+
+// FromBilly wraps fs so it can be passed to NewFilesystemBucket, letting
+// the bucket target any real go-billy backend (osfs, chroot, sftp, ...)
+// in addition to NewMemFS.
+func FromBilly(fs billy.Filesystem) Filesystem {
+	return &billyFS{fs: fs}
+}
+
+func (b *billyFS) Open(filename string) (File, error) { return b.fs.Open(filename) }
+
+func (b *billyFS) Create(filename string) (File, error) { return b.fs.Create(filename) }
+
+func (b *billyFS) Remove(filename string) error { return b.fs.Remove(filename) }
+
+func (b *billyFS) MkdirAll(filename string, perm os.FileMode) error {
+	return b.fs.MkdirAll(filename, perm)
+}
+
+func (b *billyFS) Stat(filename string) (os.FileInfo, error) { return b.fs.Stat(filename) }
+
+func (b *billyFS) ReadDir(path string) ([]os.FileInfo, error) { return b.fs.ReadDir(path) }
+
+func (b *billyFS) Join(elem ...string) string { return b.fs.Join(elem...) }
@@ -0,0 +1,144 @@
+package vfs
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memFS is a trivial in-memory Filesystem, intended for unit tests that
+// want to exercise pail's filesystem Bucket without touching real disk or
+// a remote fixture.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemFS constructs an empty in-memory Filesystem.
+func NewMemFS() Filesystem {
+	return &memFS{files: map[string][]byte{}}
+}
+
+type memFile struct {
+	name string
+	buf  *bytes.Buffer
+	fs   *memFS
+	read bool
+}
+
+func (f *memFile) Name() string               { return f.name }
+func (f *memFile) Read(p []byte) (int, error) { return f.buf.Read(p) }
+
+func (f *memFile) Write(p []byte) (int, error) { return f.buf.Write(p) }
+
+func (f *memFile) Close() error {
+	if f.read {
+		return nil
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.fs.files[f.name] = f.buf.Bytes()
+	return nil
+}
+
+func (fs *memFS) Open(filename string) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, ok := fs.files[filename]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return &memFile{name: filename, buf: bytes.NewBuffer(append([]byte{}, data...)), fs: fs, read: true}, nil
+}
+
+func (fs *memFS) Create(filename string) (File, error) {
+	return &memFile{name: filename, buf: &bytes.Buffer{}, fs: fs}, nil
+}
+
+func (fs *memFS) Remove(filename string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.files[filename]; !ok {
+		return os.ErrNotExist
+	}
+	delete(fs.files, filename)
+	return nil
+}
+
+func (fs *memFS) MkdirAll(string, os.FileMode) error { return nil }
+
+func (fs *memFS) Stat(filename string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, ok := fs.files[filename]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return memFileInfo{name: path.Base(filename), size: int64(len(data))}, nil
+}
+
+func (fs *memFS) ReadDir(dir string) ([]os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	prefix := strings.Trim(dir, "/")
+	seen := map[string]bool{}
+	var out []os.FileInfo
+
+	for name, data := range fs.files {
+		var rel string
+		switch {
+		case prefix == "":
+			rel = name
+		case name == prefix:
+			continue
+		case strings.HasPrefix(name, prefix+"/"):
+			rel = name[len(prefix)+1:]
+		default:
+			continue
+		}
+
+		if rel == "" {
+			continue
+		}
+
+		parts := strings.SplitN(rel, "/", 2)
+		child := parts[0]
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+
+		if len(parts) > 1 {
+			out = append(out, memFileInfo{name: child, isDir: true})
+		} else {
+			out = append(out, memFileInfo{name: child, size: int64(len(data))})
+		}
+	}
+
+	return out, nil
+}
+
+func (fs *memFS) Join(elem ...string) string { return path.Join(elem...) }
+
+type memFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() os.FileMode  { return 0644 }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.isDir }
+func (i memFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,26 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemFSReadDirRequiresPathBoundary(t *testing.T) {
+	require := require.New(t)
+
+	fs := NewMemFS()
+
+	for _, name := range []string{"v4.4/a.tgz", "v4.4.1.tgz"} {
+		f, err := fs.Create(name)
+		require.NoError(err)
+		_, err = f.Write([]byte(name))
+		require.NoError(err)
+		require.NoError(f.Close())
+	}
+
+	entries, err := fs.ReadDir("v4.4")
+	require.NoError(err)
+	require.Len(entries, 1)
+	require.Equal("a.tgz", entries[0].Name())
+}
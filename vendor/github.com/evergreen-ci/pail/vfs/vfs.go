@@ -0,0 +1,33 @@
+// Package vfs defines a minimal abstract filesystem interface so that
+// pail's filesystem-backed Bucket can target real disk, an in-memory
+// fixture, or any other virtual backend without a hard dependency on any
+// of them.
+package vfs
+
+import (
+	"io"
+	"os"
+)
+
+// Filesystem is the subset of go-billy's billy.Filesystem that pail's
+// filesystem Bucket needs. billy.Filesystem.Open/Create return the
+// distinct billy.File interface type, so a billy.Filesystem can't be
+// passed as a Filesystem directly even though its methods are otherwise
+// identical; wrap it with FromBilly first. NewMemFS provides an
+// in-memory implementation for tests that don't want to depend on billy
+// at all.
+type Filesystem interface {
+	Open(filename string) (File, error)
+	Create(filename string) (File, error)
+	Remove(filename string) error
+	MkdirAll(filename string, perm os.FileMode) error
+	Stat(filename string) (os.FileInfo, error)
+	ReadDir(path string) ([]os.FileInfo, error)
+	Join(elem ...string) string
+}
+
+// File is the subset of go-billy's billy.File pail needs.
+type File interface {
+	io.ReadWriteCloser
+	Name() string
+}